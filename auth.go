@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// callerIdentityKey is the gin context key under which authMiddleware stores the
+// authenticated caller, for downstream handlers and the PolicyEngine to read.
+const callerIdentityKey = "callerIdentity"
+
+// CallerIdentity is the authenticated caller verified by authMiddleware.
+type CallerIdentity struct {
+	Subject string
+	Claims  map[string]interface{}
+}
+
+// callerFromContext retrieves the CallerIdentity set by authMiddleware, if any.
+func callerFromContext(c *gin.Context) (*CallerIdentity, bool) {
+	value, ok := c.Get(callerIdentityKey)
+	if !ok {
+		return nil, false
+	}
+	caller, ok := value.(*CallerIdentity)
+	return caller, ok
+}
+
+// defaultBypassPaths are exempt from authentication regardless of AUTH_MODE.
+var defaultBypassPaths = []string{"/ping", "/healthz"}
+
+// authMiddleware enforces the backend selected by AUTH_MODE ("hmac", "jwt", or "none"
+// to explicitly disable auth) on every request except those in bypassPaths. AUTH_MODE
+// must be set to one of these values - an unset AUTH_MODE refuses to start rather than
+// silently running open, since that was exactly the "unsafe to expose" state this
+// middleware exists to close.
+func authMiddleware(bypassPaths []string) gin.HandlerFunc {
+	mode := strings.ToLower(os.Getenv("AUTH_MODE"))
+
+	switch mode {
+	case "":
+		log.Fatal("AUTH_MODE must be set explicitly (\"hmac\", \"jwt\", or \"none\") - refusing to start with authentication implicitly disabled")
+	case "none":
+		log.Print("WARNING: AUTH_MODE=none - authentication is disabled, every route is open to unauthenticated callers")
+	case "hmac", "jwt":
+		// configured below
+	default:
+		log.Fatalf("unsupported AUTH_MODE: %s", mode)
+	}
+
+	var jwks *keyfunc.JWKS
+	if mode == "jwt" {
+		jwksURL := os.Getenv("JWT_JWKS_URL")
+		fetched, err := keyfunc.Get(jwksURL, keyfunc.Options{})
+		if err != nil {
+			log.Fatalf("unable to fetch JWKS from %s: %v", jwksURL, err)
+		}
+		jwks = fetched
+	}
+
+	return func(c *gin.Context) {
+		for _, bypass := range bypassPaths {
+			if c.Request.URL.Path == bypass {
+				c.Next()
+				return
+			}
+		}
+
+		var caller *CallerIdentity
+		var err error
+
+		switch mode {
+		case "none":
+			c.Next()
+			return
+		case "hmac":
+			caller, err = verifyHMACRequest(c)
+		case "jwt":
+			caller, err = verifyJWTRequest(c, jwks)
+		}
+
+		if err != nil {
+			recordAuthFailure(mode)
+			c.JSON(401, gin.H{"error": "unauthorized: " + err.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Set(callerIdentityKey, caller)
+		c.Next()
+	}
+}
+
+// verifyHMACRequest validates the X-Signature header against hex(HMAC-SHA256(sharedSecret,
+// body)), where sharedSecret is stored alongside the Agora secrets. The caller subject
+// is taken from the X-Api-Key header, the same key the PolicyEngine evaluates against.
+func verifyHMACRequest(c *gin.Context) (*CallerIdentity, error) {
+	signature := c.GetHeader("X-Signature")
+	if signature == "" {
+		return nil, fmt.Errorf("missing X-Signature header")
+	}
+	apiKey := c.GetHeader("X-Api-Key")
+	if apiKey == "" {
+		return nil, fmt.Errorf("missing X-Api-Key header")
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read request body: %v", err)
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	secret := store.hmacSecret()
+	if secret == "" {
+		return nil, fmt.Errorf("HMAC auth is not configured")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, fmt.Errorf("signature mismatch")
+	}
+
+	nonce := c.GetHeader("X-Nonce")
+	if nonce == "" {
+		return nil, fmt.Errorf("missing X-Nonce header")
+	}
+	fresh, err := nonceStore.CheckAndStore(c.Request.Context(), nonce, hmacReplayWindow())
+	if err != nil {
+		return nil, fmt.Errorf("nonce check failed: %v", err)
+	}
+	if !fresh {
+		return nil, fmt.Errorf("nonce already used")
+	}
+
+	return &CallerIdentity{Subject: apiKey, Claims: map[string]interface{}{"apiKey": apiKey}}, nil
+}
+
+// hmacReplayWindow reads HMAC_REPLAY_WINDOW_SECONDS (default 300), the TTL a nonce is
+// remembered for, matching the signature's validity window.
+func hmacReplayWindow() time.Duration {
+	raw := os.Getenv("HMAC_REPLAY_WINDOW_SECONDS")
+	if raw == "" {
+		return 5 * time.Minute
+	}
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// verifyJWTRequest validates a Bearer JWT against the configured JWKS, checking the
+// issuer (JWT_ISSUER) and audience (JWT_AUDIENCE) when they are configured.
+func verifyJWTRequest(c *gin.Context, jwks *keyfunc.JWKS) (*CallerIdentity, error) {
+	header := c.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, fmt.Errorf("missing bearer token")
+	}
+	tokenString := strings.TrimPrefix(header, "Bearer ")
+
+	token, err := jwt.Parse(tokenString, jwks.Keyfunc)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid token: %v", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	if expectedIssuer := os.Getenv("JWT_ISSUER"); expectedIssuer != "" {
+		issuer, _ := claims.GetIssuer()
+		if issuer != expectedIssuer {
+			return nil, fmt.Errorf("unexpected issuer: %s", issuer)
+		}
+	}
+	if expectedAudience := os.Getenv("JWT_AUDIENCE"); expectedAudience != "" {
+		audiences, _ := claims.GetAudience()
+		if !containsString(audiences, expectedAudience) {
+			return nil, fmt.Errorf("unexpected audience")
+		}
+	}
+
+	subject, _ := claims.GetSubject()
+	return &CallerIdentity{Subject: subject, Claims: claims}, nil
+}
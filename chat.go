@@ -0,0 +1,54 @@
+package main
+
+import (
+	"time"
+
+	"github.com/AgoraIO-Community/go-tokenbuilder/chatTokenBuilder"
+	"github.com/gin-gonic/gin"
+)
+
+// getChatAppToken issues an app-level Agora Chat token, used by a chat server
+// to authenticate itself against the Agora Chat REST API.
+func getChatAppToken(c *gin.Context) {
+	start := time.Now()
+	defer func() { recordIssuanceLatency("chat/app", time.Since(start)) }()
+
+	expireTimestamp, err := parseExpiryParam(c)
+	if err != nil {
+		c.JSON(400, gin.H{"message": "Error Generating Chat App token: " + err.Error()})
+		return
+	}
+
+	appID, appCertificate := store.get()
+	chatToken, tokenErr := chatTokenBuilder.BuildChatAppToken(appID, appCertificate, relativeSeconds(expireTimestamp))
+	if tokenErr != nil {
+		c.JSON(400, gin.H{"error": "Error Generating Chat App token: " + tokenErr.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"chatToken": chatToken})
+	recordTokenIssued("chat/app", "", "")
+	recordAudit(c, "", "", "", []string{"chat-app"}, expireTimestamp)
+}
+
+// getChatUserToken issues a user-level Agora Chat token for the given uid.
+func getChatUserToken(c *gin.Context) {
+	start := time.Now()
+	defer func() { recordIssuanceLatency("chat/user", time.Since(start)) }()
+
+	uidStr := c.Param("uid")
+	expireTimestamp, err := parseExpiryParam(c)
+	if err != nil {
+		c.JSON(400, gin.H{"message": "Error Generating Chat User token: " + err.Error()})
+		return
+	}
+
+	appID, appCertificate := store.get()
+	chatToken, tokenErr := chatTokenBuilder.BuildChatUserToken(appID, appCertificate, uidStr, relativeSeconds(expireTimestamp))
+	if tokenErr != nil {
+		c.JSON(400, gin.H{"error": "Error Generating Chat User token: " + tokenErr.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"chatToken": chatToken})
+	recordTokenIssued("chat/user", "", "")
+	recordAudit(c, "", "", uidStr, []string{"chat-user"}, expireTimestamp)
+}
@@ -2,58 +2,20 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
 	"time"
 
-	"github.com/AgoraIO-Community/go-tokenbuilder/rtctokenbuilder"
-	"github.com/AgoraIO-Community/go-tokenbuilder/rtmtokenbuilder"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/AgoraIO-Community/go-tokenbuilder/rtctokenbuilder2"
+	"github.com/AgoraIO-Community/go-tokenbuilder/rtmtokenbuilder2"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
-// AgoraSecrets holds the structure for secrets fetched from AWS Secrets Manager
-type AgoraSecrets struct {
-	AppID          string `json:"APP_ID"`
-	AppCertificate string `json:"APP_CERTIFICATE"`
-	BaseURL        string `json:"BASE_URL"`
-}
-
-var appID string
-var appCertificate string
-
-// FetchAgoraSecrets fetches Agora secrets from AWS Secrets Manager
-func FetchAgoraSecrets(secretName string) (*AgoraSecrets, error) {
-	// Load the AWS config
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		return nil, fmt.Errorf("unable to load AWS config: %v", err)
-	}
-
-	// Create a Secrets Manager client
-	client := secretsmanager.NewFromConfig(cfg)
-
-	// Fetch the secret value
-	output, err := client.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{
-		SecretId: &secretName,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("unable to fetch secret: %v", err)
-	}
-
-	// Parse the secret value
-	var secrets AgoraSecrets
-	err = json.Unmarshal([]byte(*output.SecretString), &secrets)
-	if err != nil {
-		return nil, fmt.Errorf("unable to parse secret: %v", err)
-	}
-	return &secrets, nil
-}
+// store holds the currently active Agora secrets, kept fresh by the background refresher.
+var store = newSecretsStore()
 
 func init() {
 	// Load environment variables from .env file (if present)
@@ -63,18 +25,54 @@ func init() {
 }
 
 func main() {
+	// Build the secrets provider for the configured backend (SECRETS_BACKEND, default "aws")
+	provider, err := NewSecretsProvider()
+	if err != nil {
+		log.Fatalf("Failed to configure secrets provider: %v", err)
+	}
+
 	// Fetch Agora secrets
-	secrets, err := FetchAgoraSecrets("lag-live-agora")
+	secrets, err := provider.FetchAgoraSecrets(context.Background())
 	if err != nil {
 		log.Fatalf("Failed to fetch secrets: %v", err)
 	}
 
-	// Assign fetched secrets to global variables
-	appID = secrets.AppID
-	appCertificate = secrets.AppCertificate
+	if secrets.AppID == "" || secrets.AppCertificate == "" {
+		log.Fatal("FATAL ERROR: Secrets not properly configured, check the configured secrets backend")
+	}
+	store.set(secrets)
 
-	if appID == "" || appCertificate == "" {
-		log.Fatal("FATAL ERROR: Secrets not properly configured, check AWS Secrets Manager")
+	// Periodically re-fetch secrets so rotated credentials are picked up without a restart
+	go startSecretsRefresher(provider, store, secretsRefreshInterval())
+
+	// Load the access policy used to restrict POST /token requests
+	policyFilePath := os.Getenv("POLICY_FILE")
+	if policyFilePath == "" {
+		policyFilePath = "policy.json"
+	}
+	engine, err := NewJSONFilePolicyEngine(policyFilePath)
+	if err != nil {
+		log.Fatalf("Failed to load policy file: %v", err)
+	}
+	policyEngine = engine
+
+	// Wire up observability: tracing (TRACING_ENABLED), audit log (AUDIT_LOG_ENABLED)
+	if tracingEnabled() {
+		shutdown, err := initTracer()
+		if err != nil {
+			log.Fatalf("Failed to initialize tracing: %v", err)
+		}
+		defer shutdown(context.Background())
+	}
+	if auditEnabled() {
+		if err := initAuditLogger(); err != nil {
+			log.Fatalf("Failed to initialize audit logger: %v", err)
+		}
+	}
+
+	// Wire up rate limiting and HMAC replay protection (RATE_LIMIT_STORE, default "memory")
+	if err := initRateLimiting(); err != nil {
+		log.Fatalf("Failed to initialize rate limiting: %v", err)
 	}
 
 	// Initialize Gin server
@@ -85,6 +83,12 @@ func main() {
 		port = "8080"
 	}
 
+	api.Use(nocache())
+	if tracingEnabled() {
+		api.Use(tracingMiddleware())
+	}
+	api.Use(authMiddleware(defaultBypassPaths))
+
 	// Define routes
 	api.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -92,15 +96,37 @@ func main() {
 		})
 	})
 
-	api.Use(nocache())
-	api.GET("rtc/:channelName/:role/:tokentype/:uid/", getRtcToken)
-	api.GET("rtm/:uid/", getRtmToken)
-	api.GET("rte/:channelName/:role/:tokentype/:uid/", getBothTokens)
+	api.GET("/healthz", healthzHandler)
+	if metricsEnabled() {
+		api.GET("/metrics", metricsHandler())
+	}
+	api.GET("rtc/:channelName/:role/:tokentype/:uid/", rateLimitMiddleware("rtc"), getRtcToken)
+	api.GET("rtc/:channelName/:role/:tokentype/:uid/renew", rateLimitMiddleware("rtc"), renewRtcToken)
+	api.GET("rtm/:uid/", rateLimitMiddleware("rtm"), getRtmToken)
+	api.GET("rte/:channelName/:role/:tokentype/:uid/", rateLimitMiddleware("rte"), getBothTokens)
+	api.POST("/token", rateLimitMiddleware("token"), postToken)
+	api.GET("chat/app/", rateLimitMiddleware("chat"), getChatAppToken)
+	api.GET("chat/user/:uid/", rateLimitMiddleware("chat"), getChatUserToken)
+	api.GET("/debug/ratelimit", debugRateLimitHandler)
 
 	// Start the server
 	api.Run(":" + port)
 }
 
+// healthzHandler reports the outcome of the most recent secrets fetch.
+func healthzHandler(c *gin.Context) {
+	lastFetch, lastErr := store.status()
+	if lastFetch.IsZero() {
+		c.JSON(503, gin.H{"status": "unhealthy", "message": "secrets not yet fetched"})
+		return
+	}
+	if lastErr != nil {
+		c.JSON(200, gin.H{"status": "degraded", "lastSuccessfulFetch": lastFetch, "lastError": lastErr.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"status": "ok", "lastSuccessfulFetch": lastFetch})
+}
+
 func nocache() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Cache-Control", "private, no-cache, no-store, must-revalidate")
@@ -111,55 +137,84 @@ func nocache() gin.HandlerFunc {
 }
 
 func getRtcToken(c *gin.Context) {
-	channelName, tokentype, uidStr, role, expireTimestamp, err := parseRtcParams(c)
+	start := time.Now()
+	defer func() { recordIssuanceLatency("rtc", time.Since(start)) }()
+
+	channelName, tokentype, uidStr, role, privileges, err := parseRtcParams(c)
 	if err != nil {
 		c.JSON(400, gin.H{"message": "Error Generating RTC token: " + err.Error()})
 		return
 	}
 
-	rtcToken, tokenErr := generateRtcToken(channelName, uidStr, tokentype, role, expireTimestamp)
+	rtcToken, tokenErr := generateRtcToken(channelName, uidStr, tokentype, role, privileges)
 	if tokenErr != nil {
 		c.JSON(400, gin.H{"error": "Error Generating RTC token: " + tokenErr.Error()})
-	} else {
-		c.JSON(200, gin.H{"rtcToken": rtcToken})
+		return
 	}
+	c.JSON(200, gin.H{"rtcToken": rtcToken})
+	recordTokenIssued("rtc", c.Param("role"), tokentype)
+	recordAudit(c, channelName, c.Param("role"), uidStr, []string{"rtc"}, privileges.JoinChannel)
 }
 
 func getRtmToken(c *gin.Context) {
+	start := time.Now()
+	defer func() { recordIssuanceLatency("rtm", time.Since(start)) }()
+
 	uidStr, expireTimestamp, err := parseRtmParams(c)
 	if err != nil {
 		c.JSON(400, gin.H{"message": "Error Generating RTM token: " + err.Error()})
 		return
 	}
 
-	rtmToken, tokenErr := rtmtokenbuilder.BuildToken(appID, appCertificate, uidStr, rtmtokenbuilder.RoleRtmUser, expireTimestamp)
+	appID, appCertificate := store.get()
+	rtmToken, tokenErr := rtmtokenbuilder2.BuildToken(appID, appCertificate, uidStr, relativeSeconds(expireTimestamp))
 	if tokenErr != nil {
 		c.JSON(400, gin.H{"error": "Error Generating RTM token: " + tokenErr.Error()})
-	} else {
-		c.JSON(200, gin.H{"rtmToken": rtmToken})
+		return
 	}
+	c.JSON(200, gin.H{"rtmToken": rtmToken})
+	recordTokenIssued("rtm", "", "")
+	recordAudit(c, "", "", uidStr, []string{"rtm"}, expireTimestamp)
 }
 
 func getBothTokens(c *gin.Context) {
-	channelName, tokentype, uidStr, role, expireTimestamp, rtcParamErr := parseRtcParams(c)
+	start := time.Now()
+	defer func() { recordIssuanceLatency("rte", time.Since(start)) }()
+
+	channelName, tokentype, uidStr, role, privileges, rtcParamErr := parseRtcParams(c)
 	if rtcParamErr != nil {
 		c.JSON(400, gin.H{"message": "Error Generating RTC token: " + rtcParamErr.Error()})
 		return
 	}
 
-	rtcToken, rtcTokenErr := generateRtcToken(channelName, uidStr, tokentype, role, expireTimestamp)
-	rtmToken, rtmTokenErr := rtmtokenbuilder.BuildToken(appID, appCertificate, uidStr, rtmtokenbuilder.RoleRtmUser, expireTimestamp)
+	appID, appCertificate := store.get()
+	rtcToken, rtcTokenErr := generateRtcToken(channelName, uidStr, tokentype, role, privileges)
+	rtmToken, rtmTokenErr := rtmtokenbuilder2.BuildToken(appID, appCertificate, uidStr, relativeSeconds(privileges.JoinChannel))
 
 	if rtcTokenErr != nil {
 		c.JSON(400, gin.H{"error": "Error Generating RTC token: " + rtcTokenErr.Error()})
-	} else if rtmTokenErr != nil {
+		return
+	}
+	if rtmTokenErr != nil {
 		c.JSON(400, gin.H{"error": "Error Generating RTM token: " + rtmTokenErr.Error()})
-	} else {
-		c.JSON(200, gin.H{"rtcToken": rtcToken, "rtmToken": rtmToken})
+		return
 	}
+	c.JSON(200, gin.H{"rtcToken": rtcToken, "rtmToken": rtmToken})
+	recordTokenIssued("rte", c.Param("role"), tokentype)
+	recordTokenIssued("rte", c.Param("role"), "rtm")
+	recordAudit(c, channelName, c.Param("role"), uidStr, []string{"rtc", "rtm"}, privileges.JoinChannel)
 }
 
-func parseRtcParams(c *gin.Context) (channelName, tokentype, uidStr string, role rtctokenbuilder.Role, expireTimestamp uint32, err error) {
+// rtcPrivilegeExpirations holds the per-privilege expiration timestamps used to build
+// an RTC token, letting e.g. audio publish expire earlier than the channel join.
+type rtcPrivilegeExpirations struct {
+	JoinChannel  uint32
+	PublishAudio uint32
+	PublishVideo uint32
+	PublishData  uint32
+}
+
+func parseRtcParams(c *gin.Context) (channelName, tokentype, uidStr string, role rtctokenbuilder2.Role, privileges rtcPrivilegeExpirations, err error) {
 	channelName = c.Param("channelName")
 	roleStr := c.Param("role")
 	tokentype = c.Param("tokentype")
@@ -167,20 +222,58 @@ func parseRtcParams(c *gin.Context) (channelName, tokentype, uidStr string, role
 	expireTime := c.DefaultQuery("expiry", "3600")
 
 	if roleStr == "publisher" {
-		role = rtctokenbuilder.RolePublisher
+		role = rtctokenbuilder2.RolePublisher
 	} else {
-		role = rtctokenbuilder.RoleSubscriber
+		role = rtctokenbuilder2.RoleSubscriber
 	}
 
 	expireTime64, parseErr := strconv.ParseUint(expireTime, 10, 64)
 	if parseErr != nil {
 		err = fmt.Errorf("failed to parse expireTime: %s, causing error: %s", expireTime, parseErr)
+		return
 	}
 	currentTimestamp := uint32(time.Now().UTC().Unix())
-	expireTimestamp = uint32(expireTime64) + currentTimestamp
+	joinExpiry := uint32(expireTime64) + currentTimestamp
+
+	privileges.JoinChannel = joinExpiry
+	if privileges.PublishAudio, err = queryExpiry(c, "pubAudioExpiry", currentTimestamp, joinExpiry); err != nil {
+		return
+	}
+	if privileges.PublishVideo, err = queryExpiry(c, "pubVideoExpiry", currentTimestamp, joinExpiry); err != nil {
+		return
+	}
+	if privileges.PublishData, err = queryExpiry(c, "pubDataExpiry", currentTimestamp, joinExpiry); err != nil {
+		return
+	}
 	return
 }
 
+// queryExpiry reads an optional "<relative seconds>" query param and turns it into an
+// absolute expiry timestamp, falling back to fallback when the param is unset.
+func queryExpiry(c *gin.Context, key string, currentTimestamp, fallback uint32) (uint32, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return fallback, nil
+	}
+	seconds, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %s, causing error: %s", key, raw, err)
+	}
+	return uint32(seconds) + currentTimestamp, nil
+}
+
+// parseExpiryParam reads the common "expiry" query param (relative seconds, default
+// 3600) and returns it as an absolute expiry timestamp.
+func parseExpiryParam(c *gin.Context) (expireTimestamp uint32, err error) {
+	expireTime := c.DefaultQuery("expiry", "3600")
+	expireTime64, parseErr := strconv.ParseUint(expireTime, 10, 64)
+	if parseErr != nil {
+		return 0, fmt.Errorf("failed to parse expireTime: %s, causing error: %s", expireTime, parseErr)
+	}
+	currentTimestamp := uint32(time.Now().UTC().Unix())
+	return uint32(expireTime64) + currentTimestamp, nil
+}
+
 func parseRtmParams(c *gin.Context) (uidStr string, expireTimestamp uint32, err error) {
 	uidStr = c.Param("uid")
 	expireTime := c.DefaultQuery("expiry", "3600")
@@ -193,13 +286,39 @@ func parseRtmParams(c *gin.Context) (uidStr string, expireTimestamp uint32, err
 	return
 }
 
-func generateRtcToken(channelName, uidStr, tokentype string, role rtctokenbuilder.Role, expireTimestamp uint32) (string, error) {
+func generateRtcToken(channelName, uidStr, tokentype string, role rtctokenbuilder2.Role, privileges rtcPrivilegeExpirations) (string, error) {
+	appID, appCertificate := store.get()
+	tokenExpire := relativeSeconds(privileges.JoinChannel)
+
+	// The privilege-based builders have no role concept: a subscriber must have no
+	// publish privileges granted at all, rather than a publisher and subscriber both
+	// getting (unused) publish privileges.
+	var pubAudioExpire, pubVideoExpire, pubDataExpire uint32
+	if role == rtctokenbuilder2.RolePublisher {
+		pubAudioExpire = relativeSeconds(privileges.PublishAudio)
+		pubVideoExpire = relativeSeconds(privileges.PublishVideo)
+		pubDataExpire = relativeSeconds(privileges.PublishData)
+	}
+
 	if tokentype == "userAccount" {
-		return rtctokenbuilder.BuildTokenWithUserAccount(appID, appCertificate, channelName, uidStr, role, expireTimestamp)
+		return rtctokenbuilder2.BuildTokenWithUserAccountAndPrivilege(appID, appCertificate, channelName, uidStr,
+			tokenExpire, tokenExpire, pubAudioExpire, pubVideoExpire, pubDataExpire)
 	}
 	uid, err := strconv.ParseUint(uidStr, 10, 64)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse uidStr: %v", err)
 	}
-	return rtctokenbuilder.BuildTokenWithUID(appID, appCertificate, channelName, uint32(uid), role, expireTimestamp)
+	return rtctokenbuilder2.BuildTokenWithUidAndPrivilege(appID, appCertificate, channelName, uint32(uid),
+		tokenExpire, tokenExpire, pubAudioExpire, pubVideoExpire, pubDataExpire)
+}
+
+// relativeSeconds converts an absolute expiry timestamp (as produced by queryExpiry/
+// parseRtcParams/parseRtmParams) into the number of seconds from now, which is what
+// the go-tokenbuilder privilege builders expect.
+func relativeSeconds(absoluteExpiry uint32) uint32 {
+	now := uint32(time.Now().UTC().Unix())
+	if absoluteExpiry <= now {
+		return 0
+	}
+	return absoluteExpiry - now
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	tokensIssuedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "agora_tokens_issued_total",
+		Help: "Total number of tokens issued, labeled by route, role and token kind.",
+	}, []string{"route", "role", "tokentype"})
+
+	issuanceLatencySeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "agora_token_issuance_latency_seconds",
+		Help: "Latency of token issuance requests, labeled by route.",
+	}, []string{"route"})
+
+	authFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "agora_auth_failures_total",
+		Help: "Total number of requests rejected by the auth middleware, labeled by auth mode.",
+	}, []string{"mode"})
+
+	secretsRefreshTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "agora_secrets_refresh_total",
+		Help: "Total number of secrets refresh attempts, labeled by outcome.",
+	}, []string{"outcome"})
+)
+
+// metricsEnabled reports whether METRICS_ENABLED is set (default: enabled).
+func metricsEnabled() bool {
+	return envBoolDefault("METRICS_ENABLED", true)
+}
+
+// metricsHandler exposes /metrics in the Prometheus exposition format.
+func metricsHandler() gin.HandlerFunc {
+	handler := promhttp.Handler()
+	return func(c *gin.Context) {
+		handler.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// recordTokenIssued increments the tokens-issued counter for a successful mint.
+func recordTokenIssued(route, role, tokentype string) {
+	tokensIssuedTotal.WithLabelValues(route, role, tokentype).Inc()
+}
+
+// recordIssuanceLatency observes how long a token issuance request took.
+func recordIssuanceLatency(route string, duration time.Duration) {
+	issuanceLatencySeconds.WithLabelValues(route).Observe(duration.Seconds())
+}
+
+// recordAuthFailure increments the auth-failures counter for the given auth mode.
+func recordAuthFailure(mode string) {
+	authFailuresTotal.WithLabelValues(mode).Inc()
+}
+
+// recordSecretsRefresh increments the secrets-refresh counter for the given outcome
+// ("success" or "failure").
+func recordSecretsRefresh(outcome string) {
+	secretsRefreshTotal.WithLabelValues(outcome).Inc()
+}
+
+// envBoolDefault parses a boolean env var, returning def when unset or invalid.
+func envBoolDefault(key string, def bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return def
+	}
+	return value
+}
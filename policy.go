@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ScopeRequest describes the token scope a caller is asking to be issued.
+type ScopeRequest struct {
+	Channels   []string
+	Role       string
+	UID        string
+	TokenKinds []string
+	Expiry     uint32
+}
+
+// PolicyDecision is the result of evaluating a ScopeRequest against a PolicyEngine.
+type PolicyDecision struct {
+	Allowed bool
+	Reason  string
+}
+
+// PolicyEngine decides whether a scoped token request is permitted for a given
+// authenticated caller (identified here by API key; see auth middleware for the
+// JWT/HMAC-authenticated subject equivalent).
+type PolicyEngine interface {
+	Evaluate(apiKey string, req ScopeRequest) (*PolicyDecision, error)
+}
+
+// apiKeyPolicy is the policy configured for a single API key.
+type apiKeyPolicy struct {
+	MaxExpirySeconds       uint32   `json:"maxExpirySeconds"`
+	AllowedChannelPrefixes []string `json:"allowedChannelPrefixes"`
+	AllowedRoles           []string `json:"allowedRoles"`
+}
+
+// policyFile is the on-disk shape of the JSON policy file.
+type policyFile struct {
+	DefaultMaxExpirySeconds uint32                  `json:"defaultMaxExpirySeconds"`
+	APIKeys                 map[string]apiKeyPolicy `json:"apiKeys"`
+}
+
+// JSONFilePolicyEngine is the default PolicyEngine, backed by a JSON file on disk
+// mapping API keys to their allowed scope.
+type JSONFilePolicyEngine struct {
+	file policyFile
+}
+
+// NewJSONFilePolicyEngine loads the policy file at path into memory.
+func NewJSONFilePolicyEngine(path string) (*JSONFilePolicyEngine, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read policy file: %v", err)
+	}
+	var file policyFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("unable to parse policy file: %v", err)
+	}
+	return &JSONFilePolicyEngine{file: file}, nil
+}
+
+// Evaluate checks req against the policy configured for apiKey.
+func (e *JSONFilePolicyEngine) Evaluate(apiKey string, req ScopeRequest) (*PolicyDecision, error) {
+	keyPolicy, ok := e.file.APIKeys[apiKey]
+	if !ok {
+		return &PolicyDecision{Allowed: false, Reason: "unknown API key"}, nil
+	}
+
+	maxExpiry := keyPolicy.MaxExpirySeconds
+	if maxExpiry == 0 {
+		maxExpiry = e.file.DefaultMaxExpirySeconds
+	}
+	if maxExpiry > 0 && req.Expiry > maxExpiry {
+		return &PolicyDecision{Allowed: false, Reason: fmt.Sprintf("requested expiry %ds exceeds max allowed %ds", req.Expiry, maxExpiry)}, nil
+	}
+
+	if len(keyPolicy.AllowedRoles) > 0 && !containsString(keyPolicy.AllowedRoles, req.Role) {
+		return &PolicyDecision{Allowed: false, Reason: fmt.Sprintf("role %q not permitted for this API key", req.Role)}, nil
+	}
+
+	if len(keyPolicy.AllowedChannelPrefixes) > 0 {
+		for _, channel := range req.Channels {
+			if !hasAnyPrefix(channel, keyPolicy.AllowedChannelPrefixes) {
+				return &PolicyDecision{Allowed: false, Reason: fmt.Sprintf("channel %q not permitted for this API key", channel)}, nil
+			}
+		}
+	}
+
+	return &PolicyDecision{Allowed: true}, nil
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(value string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
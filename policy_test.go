@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestPolicyEngine(t *testing.T, file policyFile) *JSONFilePolicyEngine {
+	t.Helper()
+	raw, err := json.Marshal(file)
+	if err != nil {
+		t.Fatalf("failed to marshal policy file: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatalf("failed to write policy file: %v", err)
+	}
+	engine, err := NewJSONFilePolicyEngine(path)
+	if err != nil {
+		t.Fatalf("NewJSONFilePolicyEngine: %v", err)
+	}
+	return engine
+}
+
+func TestJSONFilePolicyEngineEvaluate(t *testing.T) {
+	engine := newTestPolicyEngine(t, policyFile{
+		DefaultMaxExpirySeconds: 3600,
+		APIKeys: map[string]apiKeyPolicy{
+			"restricted": {
+				MaxExpirySeconds:       600,
+				AllowedChannelPrefixes: []string{"team-"},
+				AllowedRoles:           []string{"subscriber"},
+			},
+			"unrestricted": {},
+		},
+	})
+
+	tests := []struct {
+		name        string
+		apiKey      string
+		req         ScopeRequest
+		wantAllowed bool
+	}{
+		{
+			name:        "unknown api key is denied",
+			apiKey:      "nope",
+			req:         ScopeRequest{Channels: []string{"team-a"}, Role: "subscriber", Expiry: 60},
+			wantAllowed: false,
+		},
+		{
+			name:        "expiry within key-specific max is allowed",
+			apiKey:      "restricted",
+			req:         ScopeRequest{Channels: []string{"team-a"}, Role: "subscriber", Expiry: 600},
+			wantAllowed: true,
+		},
+		{
+			name:        "expiry over key-specific max is denied",
+			apiKey:      "restricted",
+			req:         ScopeRequest{Channels: []string{"team-a"}, Role: "subscriber", Expiry: 601},
+			wantAllowed: false,
+		},
+		{
+			name:        "disallowed role is denied",
+			apiKey:      "restricted",
+			req:         ScopeRequest{Channels: []string{"team-a"}, Role: "publisher", Expiry: 60},
+			wantAllowed: false,
+		},
+		{
+			name:        "channel outside allowed prefixes is denied",
+			apiKey:      "restricted",
+			req:         ScopeRequest{Channels: []string{"other-a"}, Role: "subscriber", Expiry: 60},
+			wantAllowed: false,
+		},
+		{
+			name:        "one of several channels outside allowed prefixes is denied",
+			apiKey:      "restricted",
+			req:         ScopeRequest{Channels: []string{"team-a", "other-a"}, Role: "subscriber", Expiry: 60},
+			wantAllowed: false,
+		},
+		{
+			name:        "key with no restrictions falls back to the default max expiry",
+			apiKey:      "unrestricted",
+			req:         ScopeRequest{Channels: []string{"anything"}, Role: "publisher", Expiry: 3600},
+			wantAllowed: true,
+		},
+		{
+			name:        "key with no restrictions still enforces the default max expiry",
+			apiKey:      "unrestricted",
+			req:         ScopeRequest{Channels: []string{"anything"}, Role: "publisher", Expiry: 3601},
+			wantAllowed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := engine.Evaluate(tt.apiKey, tt.req)
+			if err != nil {
+				t.Fatalf("Evaluate returned error: %v", err)
+			}
+			if decision.Allowed != tt.wantAllowed {
+				t.Errorf("Allowed = %v, reason %q, want %v", decision.Allowed, decision.Reason, tt.wantAllowed)
+			}
+			if !tt.wantAllowed && decision.Reason == "" {
+				t.Error("expected a reason for a denied decision")
+			}
+		})
+	}
+}
+
+func TestHasAnyPrefix(t *testing.T) {
+	if !hasAnyPrefix("team-a", []string{"other-", "team-"}) {
+		t.Error("expected team-a to match the team- prefix")
+	}
+	if hasAnyPrefix("team-a", []string{"other-"}) {
+		t.Error("did not expect team-a to match the other- prefix")
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitStore implements a token-bucket rate limiter keyed by an arbitrary string
+// (typically authenticated subject + channel). The in-memory implementation is the
+// default; redisRateLimitStore backs multi-instance deployments.
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, rate float64, burst int) (allowed bool, retryAfter time.Duration, err error)
+	Snapshot(ctx context.Context, key string) (tokens float64, err error)
+}
+
+// NonceStore rejects replayed HMAC-signed requests by remembering nonces for a
+// short TTL matching the signature's validity window.
+type NonceStore interface {
+	CheckAndStore(ctx context.Context, nonce string, ttl time.Duration) (fresh bool, err error)
+}
+
+// rateLimitStore and nonceStore are the process-wide stores, selected by initRateLimiting.
+var (
+	rateLimitStore RateLimitStore = newMemoryRateLimitStore()
+	nonceStore     NonceStore     = newMemoryNonceStore()
+)
+
+// initRateLimiting configures rateLimitStore and nonceStore from RATE_LIMIT_STORE
+// ("memory", default, or "redis"). Both stores share the same backend so the HMAC
+// replay nonces and rate-limit buckets live in one place for multi-instance deployments.
+func initRateLimiting() error {
+	backend := strings.ToLower(os.Getenv("RATE_LIMIT_STORE"))
+	switch backend {
+	case "", "memory":
+		rateLimitStore = newMemoryRateLimitStore()
+		nonceStore = newMemoryNonceStore()
+	case "redis":
+		addr := os.Getenv("REDIS_ADDR")
+		if addr == "" {
+			return fmt.Errorf("redis rate limit store requires REDIS_ADDR")
+		}
+		client := redis.NewClient(&redis.Options{Addr: addr, Password: os.Getenv("REDIS_PASSWORD")})
+		rateLimitStore = newRedisRateLimitStore(client)
+		nonceStore = &redisNonceStore{client: client}
+	default:
+		return fmt.Errorf("unsupported RATE_LIMIT_STORE: %s", backend)
+	}
+	return nil
+}
+
+// tokenBucket is the in-memory bucket state for a single key.
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+func (s *memoryRateLimitStore) Allow(_ context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(burst), lastRefill: now}
+		s.buckets[key] = bucket
+	}
+
+	elapsed := now.Sub(bucket.lastRefill).Seconds()
+	bucket.tokens = minFloat(float64(burst), bucket.tokens+elapsed*rate)
+	bucket.lastRefill = now
+
+	if bucket.tokens < 1 {
+		retryAfter := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+		return false, retryAfter, nil
+	}
+
+	bucket.tokens--
+	return true, 0, nil
+}
+
+func (s *memoryRateLimitStore) Snapshot(_ context.Context, key string) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.buckets[key]
+	if !ok {
+		return 0, nil
+	}
+	return bucket.tokens, nil
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// redisTokenBucketScript atomically refills and debits a token bucket stored as a
+// Redis hash {tokens, last_refill}, so multiple server instances share state.
+const redisTokenBucketScript = `
+local tokensKey = KEYS[1]
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", tokensKey, "tokens", "last_refill")
+local tokens = tonumber(bucket[1])
+local lastRefill = tonumber(bucket[2])
+if tokens == nil then
+  tokens = burst
+  lastRefill = now
+end
+
+local elapsed = math.max(0, now - lastRefill)
+tokens = math.min(burst, tokens + elapsed * rate)
+
+local allowed = 0
+if tokens >= 1 then
+  allowed = 1
+  tokens = tokens - 1
+end
+
+redis.call("HSET", tokensKey, "tokens", tokens, "last_refill", now)
+redis.call("EXPIRE", tokensKey, math.ceil(burst / rate) + 60)
+
+return {allowed, tostring(tokens)}
+`
+
+type redisRateLimitStore struct {
+	client *redis.Client
+}
+
+func newRedisRateLimitStore(client *redis.Client) *redisRateLimitStore {
+	return &redisRateLimitStore{client: client}
+}
+
+func (s *redisRateLimitStore) Allow(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	now := float64(time.Now().UnixNano()) / float64(time.Second)
+	result, err := s.client.Eval(ctx, redisTokenBucketScript, []string{"ratelimit:" + key}, rate, burst, now).Result()
+	if err != nil {
+		return false, 0, fmt.Errorf("rate limit script failed: %v", err)
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit script result")
+	}
+	allowed := fmt.Sprintf("%v", values[0]) == "1"
+	tokens, _ := strconv.ParseFloat(fmt.Sprintf("%v", values[1]), 64)
+
+	if allowed {
+		return true, 0, nil
+	}
+	retryAfter := time.Duration((1 - tokens) / rate * float64(time.Second))
+	return false, retryAfter, nil
+}
+
+func (s *redisRateLimitStore) Snapshot(ctx context.Context, key string) (float64, error) {
+	raw, err := s.client.HGet(ctx, "ratelimit:"+key, "tokens").Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(raw, 64)
+}
+
+// memoryNonceStore is the default NonceStore, backed by an in-process map.
+type memoryNonceStore struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newMemoryNonceStore() *memoryNonceStore {
+	return &memoryNonceStore{seen: make(map[string]time.Time)}
+}
+
+func (s *memoryNonceStore) CheckAndStore(_ context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for seenNonce, expiresAt := range s.seen {
+		if expiresAt.Before(now) {
+			delete(s.seen, seenNonce)
+		}
+	}
+
+	if expiresAt, ok := s.seen[nonce]; ok && expiresAt.After(now) {
+		return false, nil
+	}
+	s.seen[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+// redisNonceStore persists nonces as short-TTL keys, shared across server instances.
+type redisNonceStore struct {
+	client *redis.Client
+}
+
+func (s *redisNonceStore) CheckAndStore(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	fresh, err := s.client.SetNX(ctx, "nonce:"+nonce, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("nonce check failed: %v", err)
+	}
+	return fresh, nil
+}
+
+// rateLimitConfig holds the rate (tokens/sec) and burst for a single route.
+type rateLimitConfig struct {
+	Rate  float64
+	Burst int
+}
+
+// rateLimitConfigFor reads "<ROUTE>_RATE" (e.g. "10/min") and "BURST" (default 20) from
+// the environment. A route with no "<ROUTE>_RATE" configured is not rate limited.
+func rateLimitConfigFor(route string) (rateLimitConfig, bool) {
+	raw := os.Getenv(strings.ToUpper(route) + "_RATE")
+	if raw == "" {
+		return rateLimitConfig{}, false
+	}
+	rate, err := parseRate(raw)
+	if err != nil {
+		log.Printf("invalid %s_RATE %q: %v", strings.ToUpper(route), raw, err)
+		return rateLimitConfig{}, false
+	}
+	burst := 20
+	if rawBurst := os.Getenv("BURST"); rawBurst != "" {
+		if parsed, err := strconv.Atoi(rawBurst); err == nil {
+			burst = parsed
+		}
+	}
+	return rateLimitConfig{Rate: rate, Burst: burst}, true
+}
+
+// parseRate parses rate strings like "10/min", "5/sec", "100/hour" into tokens/sec.
+func parseRate(raw string) (float64, error) {
+	parts := strings.SplitN(raw, "/", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("expected format <count>/<unit>, e.g. 10/min")
+	}
+	count, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid count: %v", err)
+	}
+	var seconds float64
+	switch strings.ToLower(parts[1]) {
+	case "sec", "second", "seconds":
+		seconds = 1
+	case "min", "minute", "minutes":
+		seconds = 60
+	case "hour", "hours":
+		seconds = 3600
+	default:
+		return 0, fmt.Errorf("unsupported unit: %s", parts[1])
+	}
+	return count / seconds, nil
+}
+
+// rateLimitMiddleware enforces the <route>_RATE / BURST token bucket for route, keyed
+// by the authenticated caller's subject (falling back to client IP) plus channel.
+func rateLimitMiddleware(route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg, enabled := rateLimitConfigFor(route)
+		if !enabled {
+			c.Next()
+			return
+		}
+
+		key := rateLimitKey(c, route)
+		allowed, retryAfter, err := rateLimitStore.Allow(c.Request.Context(), key, cfg.Rate, cfg.Burst)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "rate limit check failed: " + err.Error()})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			c.JSON(429, gin.H{"error": "rate limit exceeded"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitKey builds the key a request is rate-limited under: authenticated subject
+// (or client IP when unauthenticated) plus route and channel.
+func rateLimitKey(c *gin.Context, route string) string {
+	subject := c.ClientIP()
+	if caller, ok := callerFromContext(c); ok {
+		subject = caller.Subject
+	}
+	channel := c.Param("channelName")
+	if channel == "" {
+		channel = "-"
+	}
+	return fmt.Sprintf("%s:%s:%s", route, subject, channel)
+}
+
+// debugRateLimitHandler reports the current bucket state for the caller's key across
+// every rate-limited route. Gated by the same auth middleware as the token routes.
+func debugRateLimitHandler(c *gin.Context) {
+	routes := []string{"rtc", "rtm", "rte", "token", "chat"}
+	buckets := gin.H{}
+	for _, route := range routes {
+		if _, enabled := rateLimitConfigFor(route); !enabled {
+			continue
+		}
+		key := rateLimitKey(c, route)
+		tokens, err := rateLimitStore.Snapshot(c.Request.Context(), key)
+		if err != nil {
+			continue
+		}
+		buckets[route] = gin.H{"key": key, "tokens": tokens}
+	}
+	c.JSON(200, gin.H{"buckets": buckets})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStoreAllow(t *testing.T) {
+	store := newMemoryRateLimitStore()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		allowed, _, err := store.Allow(ctx, "key", 1, 3)
+		if err != nil {
+			t.Fatalf("Allow returned error: %v", err)
+		}
+		if !allowed {
+			t.Fatalf("request %d: expected burst capacity to allow the request", i)
+		}
+	}
+
+	allowed, retryAfter, err := store.Allow(ctx, "key", 1, 3)
+	if err != nil {
+		t.Fatalf("Allow returned error: %v", err)
+	}
+	if allowed {
+		t.Fatal("expected the bucket to be exhausted after burst requests")
+	}
+	if retryAfter <= 0 {
+		t.Errorf("retryAfter = %v, want > 0 once the bucket is exhausted", retryAfter)
+	}
+
+	tokens, err := store.Snapshot(ctx, "key")
+	if err != nil {
+		t.Fatalf("Snapshot returned error: %v", err)
+	}
+	if tokens < 0 || tokens >= 1 {
+		t.Errorf("tokens = %v, want in [0, 1) after exhausting the bucket", tokens)
+	}
+}
+
+func TestMemoryRateLimitStoreRefillsOverTime(t *testing.T) {
+	store := newMemoryRateLimitStore()
+	ctx := context.Background()
+
+	if allowed, _, err := store.Allow(ctx, "key", 1000, 1); err != nil || !allowed {
+		t.Fatalf("expected the first request to be allowed, allowed=%v err=%v", allowed, err)
+	}
+	if allowed, _, err := store.Allow(ctx, "key", 1000, 1); err != nil || allowed {
+		t.Fatalf("expected the bucket to be exhausted immediately after, allowed=%v err=%v", allowed, err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	allowed, _, err := store.Allow(ctx, "key", 1000, 1)
+	if err != nil {
+		t.Fatalf("Allow returned error: %v", err)
+	}
+	if !allowed {
+		t.Error("expected the bucket to have refilled a token after a high-rate wait")
+	}
+}
+
+func TestMemoryRateLimitStoreSnapshotUnknownKey(t *testing.T) {
+	store := newMemoryRateLimitStore()
+	tokens, err := store.Snapshot(context.Background(), "never-seen")
+	if err != nil {
+		t.Fatalf("Snapshot returned error: %v", err)
+	}
+	if tokens != 0 {
+		t.Errorf("tokens = %v, want 0 for an unseen key", tokens)
+	}
+}
+
+func TestMemoryNonceStoreCheckAndStore(t *testing.T) {
+	store := newMemoryNonceStore()
+	ctx := context.Background()
+
+	fresh, err := store.CheckAndStore(ctx, "nonce-1", time.Minute)
+	if err != nil {
+		t.Fatalf("CheckAndStore returned error: %v", err)
+	}
+	if !fresh {
+		t.Fatal("expected the first use of a nonce to be reported as fresh")
+	}
+
+	fresh, err = store.CheckAndStore(ctx, "nonce-1", time.Minute)
+	if err != nil {
+		t.Fatalf("CheckAndStore returned error: %v", err)
+	}
+	if fresh {
+		t.Fatal("expected a replayed nonce to be reported as not fresh")
+	}
+}
+
+func TestMemoryNonceStoreExpiresAfterTTL(t *testing.T) {
+	store := newMemoryNonceStore()
+	ctx := context.Background()
+
+	if fresh, err := store.CheckAndStore(ctx, "nonce-1", time.Millisecond); err != nil || !fresh {
+		t.Fatalf("expected the first use to be fresh, fresh=%v err=%v", fresh, err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	fresh, err := store.CheckAndStore(ctx, "nonce-1", time.Minute)
+	if err != nil {
+		t.Fatalf("CheckAndStore returned error: %v", err)
+	}
+	if !fresh {
+		t.Fatal("expected a nonce to be reusable once its TTL has expired")
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    float64
+		wantErr bool
+	}{
+		{raw: "10/sec", want: 10},
+		{raw: "60/min", want: 1},
+		{raw: "3600/hour", want: 1},
+		{raw: "10/second", want: 10},
+		{raw: "invalid", wantErr: true},
+		{raw: "10/fortnight", wantErr: true},
+		{raw: "abc/min", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := parseRate(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseRate(%q) = %v, want an error", tt.raw, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRate(%q) returned error: %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseRate(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
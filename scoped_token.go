@@ -0,0 +1,128 @@
+package main
+
+import (
+	"time"
+
+	"github.com/AgoraIO-Community/go-tokenbuilder/rtctokenbuilder2"
+	"github.com/AgoraIO-Community/go-tokenbuilder/rtmtokenbuilder2"
+	"github.com/gin-gonic/gin"
+)
+
+// policyEngine is the PolicyEngine consulted by postToken before minting any tokens.
+var policyEngine PolicyEngine
+
+// scopeTokenRequest is the POST /token request body: a caller-requested capability
+// set that the configured PolicyEngine narrows down before tokens are minted.
+type scopeTokenRequest struct {
+	Channels   []string               `json:"channels" binding:"required"`
+	Role       string                 `json:"role" binding:"required"`
+	UID        string                 `json:"uid" binding:"required"`
+	TokenKinds []string               `json:"tokenKinds"`
+	Expiry     uint32                 `json:"expiry"`
+	Privileges *privilegeWindowsInput `json:"privileges"`
+}
+
+// privilegeWindowsInput lets a caller request that individual publish privileges
+// expire earlier than the overall channel join.
+type privilegeWindowsInput struct {
+	PublishAudio uint32 `json:"publishAudio"`
+	PublishVideo uint32 `json:"publishVideo"`
+	PublishData  uint32 `json:"publishData"`
+}
+
+// postToken mints only the tokens that fall within a caller's requested scope,
+// after the PolicyEngine has approved that scope for the caller's API key.
+func postToken(c *gin.Context) {
+	start := time.Now()
+	defer func() { recordIssuanceLatency("token", time.Since(start)) }()
+
+	var req scopeTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	if len(req.Channels) == 0 {
+		c.JSON(400, gin.H{"error": "at least one channel is required"})
+		return
+	}
+	if req.Expiry == 0 {
+		req.Expiry = 3600
+	}
+	if len(req.TokenKinds) == 0 {
+		req.TokenKinds = []string{"rtc"}
+	}
+
+	apiKey := c.GetHeader("X-Api-Key")
+	if caller, ok := callerFromContext(c); ok {
+		apiKey = caller.Subject
+	}
+	decision, err := policyEngine.Evaluate(apiKey, ScopeRequest{
+		Channels:   req.Channels,
+		Role:       req.Role,
+		UID:        req.UID,
+		TokenKinds: req.TokenKinds,
+		Expiry:     req.Expiry,
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "policy evaluation failed: " + err.Error()})
+		return
+	}
+	if !decision.Allowed {
+		c.JSON(403, gin.H{"error": "request exceeds policy", "reason": decision.Reason})
+		return
+	}
+
+	currentTimestamp := uint32(time.Now().UTC().Unix())
+	joinExpiry := currentTimestamp + req.Expiry
+
+	// Privilege windows are clamped to req.Expiry (already policy-approved above)
+	// so a caller can't smuggle a long-lived publish privilege past the policy's
+	// max expiry by requesting a short join expiry alongside it.
+	pubAudioExpiry, pubVideoExpiry, pubDataExpiry := joinExpiry, joinExpiry, joinExpiry
+	if req.Privileges != nil {
+		if req.Privileges.PublishAudio > 0 && req.Privileges.PublishAudio < req.Expiry {
+			pubAudioExpiry = currentTimestamp + req.Privileges.PublishAudio
+		}
+		if req.Privileges.PublishVideo > 0 && req.Privileges.PublishVideo < req.Expiry {
+			pubVideoExpiry = currentTimestamp + req.Privileges.PublishVideo
+		}
+		if req.Privileges.PublishData > 0 && req.Privileges.PublishData < req.Expiry {
+			pubDataExpiry = currentTimestamp + req.Privileges.PublishData
+		}
+	}
+
+	appID, appCertificate := store.get()
+
+	tokens := make(gin.H, len(req.Channels))
+	for _, channel := range req.Channels {
+		channelTokens := gin.H{}
+		for _, kind := range req.TokenKinds {
+			switch kind {
+			case "rtc":
+				token, tokenErr := rtctokenbuilder2.BuildTokenWithUserAccountAndPrivilege(
+					appID, appCertificate, channel, req.UID,
+					relativeSeconds(joinExpiry), relativeSeconds(joinExpiry),
+					relativeSeconds(pubAudioExpiry), relativeSeconds(pubVideoExpiry), relativeSeconds(pubDataExpiry),
+				)
+				if tokenErr != nil {
+					c.JSON(400, gin.H{"error": "Error Generating RTC token: " + tokenErr.Error()})
+					return
+				}
+				channelTokens["rtcToken"] = token
+				recordTokenIssued("token", req.Role, "rtc")
+			case "rtm":
+				token, tokenErr := rtmtokenbuilder2.BuildToken(appID, appCertificate, req.UID, relativeSeconds(joinExpiry))
+				if tokenErr != nil {
+					c.JSON(400, gin.H{"error": "Error Generating RTM token: " + tokenErr.Error()})
+					return
+				}
+				channelTokens["rtmToken"] = token
+				recordTokenIssued("token", req.Role, "rtm")
+			}
+		}
+		tokens[channel] = channelTokens
+		recordAudit(c, channel, req.Role, req.UID, req.TokenKinds, joinExpiry)
+	}
+
+	c.JSON(200, gin.H{"tokens": tokens})
+}
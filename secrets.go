@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	secretmanagerpb "cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	vaultapi "github.com/hashicorp/vault/api"
+	"go.opentelemetry.io/otel"
+)
+
+// AgoraSecrets holds the structure for secrets fetched from the configured backend
+type AgoraSecrets struct {
+	AppID          string `json:"APP_ID"`
+	AppCertificate string `json:"APP_CERTIFICATE"`
+	BaseURL        string `json:"BASE_URL"`
+	HMACSecret     string `json:"HMAC_SECRET"`
+}
+
+// SecretsProvider fetches AgoraSecrets from a backing secrets store. Implementations
+// should be safe to call repeatedly from the background refresher. ctx carries the
+// OpenTelemetry span (when tracing is enabled) across the fetch call.
+type SecretsProvider interface {
+	FetchAgoraSecrets(ctx context.Context) (*AgoraSecrets, error)
+}
+
+// NewSecretsProvider builds a SecretsProvider based on the SECRETS_BACKEND env var.
+// Supported values: "aws" (default, current behavior), "vault", "gcp", "env".
+func NewSecretsProvider() (SecretsProvider, error) {
+	backend := strings.ToLower(os.Getenv("SECRETS_BACKEND"))
+	switch backend {
+	case "", "aws":
+		secretName := os.Getenv("AWS_SECRET_NAME")
+		if secretName == "" {
+			secretName = "lag-live-agora"
+		}
+		return &AWSSecretsProvider{SecretName: secretName}, nil
+	case "vault":
+		addr := os.Getenv("VAULT_ADDR")
+		token := os.Getenv("VAULT_TOKEN")
+		path := os.Getenv("VAULT_SECRET_PATH")
+		if addr == "" || token == "" || path == "" {
+			return nil, fmt.Errorf("vault backend requires VAULT_ADDR, VAULT_TOKEN and VAULT_SECRET_PATH")
+		}
+		return &VaultSecretsProvider{Address: addr, Token: token, Path: path}, nil
+	case "gcp":
+		project := os.Getenv("GCP_PROJECT_ID")
+		secretID := os.Getenv("GCP_SECRET_ID")
+		if project == "" || secretID == "" {
+			return nil, fmt.Errorf("gcp backend requires GCP_PROJECT_ID and GCP_SECRET_ID")
+		}
+		version := os.Getenv("GCP_SECRET_VERSION")
+		if version == "" {
+			version = "latest"
+		}
+		return &GCPSecretsProvider{ProjectID: project, SecretID: secretID, Version: version}, nil
+	case "env":
+		return &EnvSecretsProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported SECRETS_BACKEND: %s", backend)
+	}
+}
+
+// AWSSecretsProvider fetches Agora secrets from AWS Secrets Manager.
+type AWSSecretsProvider struct {
+	SecretName string
+}
+
+// FetchAgoraSecrets fetches Agora secrets from AWS Secrets Manager
+func (p *AWSSecretsProvider) FetchAgoraSecrets(ctx context.Context) (*AgoraSecrets, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS config: %v", err)
+	}
+
+	client := secretsmanager.NewFromConfig(cfg)
+
+	output, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: &p.SecretName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch secret: %v", err)
+	}
+
+	var secrets AgoraSecrets
+	if err := json.Unmarshal([]byte(*output.SecretString), &secrets); err != nil {
+		return nil, fmt.Errorf("unable to parse secret: %v", err)
+	}
+	return &secrets, nil
+}
+
+// VaultSecretsProvider fetches Agora secrets from a HashiCorp Vault KV v2 mount.
+type VaultSecretsProvider struct {
+	Address string
+	Token   string
+	Path    string
+}
+
+// FetchAgoraSecrets fetches Agora secrets from Vault KV v2 at the configured path.
+func (p *VaultSecretsProvider) FetchAgoraSecrets(ctx context.Context) (*AgoraSecrets, error) {
+	client, err := vaultapi.NewClient(&vaultapi.Config{Address: p.Address})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create vault client: %v", err)
+	}
+	client.SetToken(p.Token)
+
+	secret, err := client.Logical().ReadWithContext(ctx, p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read vault secret: %v", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("no secret found at vault path: %s", p.Path)
+	}
+
+	// KV v2 nests the stored fields under a "data" key.
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		data = secret.Data
+	}
+
+	appID, ok := data["APP_ID"].(string)
+	if !ok || appID == "" {
+		return nil, fmt.Errorf("vault secret at %s is missing APP_ID", p.Path)
+	}
+	appCertificate, ok := data["APP_CERTIFICATE"].(string)
+	if !ok || appCertificate == "" {
+		return nil, fmt.Errorf("vault secret at %s is missing APP_CERTIFICATE", p.Path)
+	}
+	baseURL, _ := data["BASE_URL"].(string)
+	hmacSecret, _ := data["HMAC_SECRET"].(string)
+
+	return &AgoraSecrets{
+		AppID:          appID,
+		AppCertificate: appCertificate,
+		BaseURL:        baseURL,
+		HMACSecret:     hmacSecret,
+	}, nil
+}
+
+// GCPSecretsProvider fetches Agora secrets from GCP Secret Manager.
+type GCPSecretsProvider struct {
+	ProjectID string
+	SecretID  string
+	Version   string
+}
+
+// FetchAgoraSecrets fetches and parses the latest (or configured) version of the secret.
+func (p *GCPSecretsProvider) FetchAgoraSecrets(ctx context.Context) (*AgoraSecrets, error) {
+	client, err := secretmanager.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create gcp secretmanager client: %v", err)
+	}
+	defer client.Close()
+
+	name := fmt.Sprintf("projects/%s/secrets/%s/versions/%s", p.ProjectID, p.SecretID, p.Version)
+	result, err := client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("unable to access gcp secret version: %v", err)
+	}
+
+	var secrets AgoraSecrets
+	if err := json.Unmarshal(result.Payload.Data, &secrets); err != nil {
+		return nil, fmt.Errorf("unable to parse secret: %v", err)
+	}
+	return &secrets, nil
+}
+
+// EnvSecretsProvider reads Agora secrets directly from environment variables
+// (populated from a .env file via godotenv, matching the dev.to tutorial template).
+type EnvSecretsProvider struct{}
+
+// FetchAgoraSecrets reads APP_ID, APP_CERTIFICATE, BASE_URL and HMAC_SECRET from
+// the environment.
+func (p *EnvSecretsProvider) FetchAgoraSecrets(ctx context.Context) (*AgoraSecrets, error) {
+	appID := os.Getenv("APP_ID")
+	appCertificate := os.Getenv("APP_CERTIFICATE")
+	if appID == "" || appCertificate == "" {
+		return nil, fmt.Errorf("APP_ID and APP_CERTIFICATE must be set when SECRETS_BACKEND=env")
+	}
+	return &AgoraSecrets{
+		AppID:          appID,
+		AppCertificate: appCertificate,
+		BaseURL:        os.Getenv("BASE_URL"),
+		HMACSecret:     os.Getenv("HMAC_SECRET"),
+	}, nil
+}
+
+// secretsStore holds the currently active Agora secrets behind a mutex so the
+// background refresher can atomically swap them while request handlers read them.
+type secretsStore struct {
+	mu        sync.RWMutex
+	secrets   *AgoraSecrets
+	lastFetch time.Time
+	lastErr   error
+}
+
+func newSecretsStore() *secretsStore {
+	return &secretsStore{}
+}
+
+func (s *secretsStore) set(secrets *AgoraSecrets) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets = secrets
+	s.lastFetch = time.Now().UTC()
+	s.lastErr = nil
+}
+
+func (s *secretsStore) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr = err
+}
+
+func (s *secretsStore) get() (appID, appCertificate string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.secrets == nil {
+		return "", ""
+	}
+	return s.secrets.AppID, s.secrets.AppCertificate
+}
+
+func (s *secretsStore) status() (lastFetch time.Time, lastErr error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastFetch, s.lastErr
+}
+
+// hmacSecret returns the shared secret used to verify HMAC-signed requests.
+func (s *secretsStore) hmacSecret() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.secrets == nil {
+		return ""
+	}
+	return s.secrets.HMACSecret
+}
+
+// secretsRefreshInterval reads SECRETS_REFRESH_INTERVAL (seconds, default 300).
+func secretsRefreshInterval() time.Duration {
+	raw := os.Getenv("SECRETS_REFRESH_INTERVAL")
+	if raw == "" {
+		return 5 * time.Minute
+	}
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// startSecretsRefresher periodically re-fetches secrets from provider and swaps
+// them into store so rotated credentials are picked up without a restart.
+func startSecretsRefresher(provider SecretsProvider, store *secretsStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, span := otel.Tracer(tracerServiceName).Start(context.Background(), "secrets.refresh")
+		secrets, err := provider.FetchAgoraSecrets(ctx)
+		if err != nil {
+			log.Printf("secrets refresh failed: %v", err)
+			store.setErr(err)
+			recordSecretsRefresh("failure")
+			span.End()
+			continue
+		}
+		if secrets.AppID == "" || secrets.AppCertificate == "" {
+			log.Printf("secrets refresh skipped: fetched secrets were incomplete")
+			store.setErr(fmt.Errorf("fetched secrets were incomplete"))
+			recordSecretsRefresh("failure")
+			span.End()
+			continue
+		}
+		store.set(secrets)
+		recordSecretsRefresh("success")
+		span.End()
+	}
+}
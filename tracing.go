@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+const tracerServiceName = "agora-token-server"
+
+// tracingEnabled reports whether TRACING_ENABLED is set (default: disabled).
+func tracingEnabled() bool {
+	return envBoolDefault("TRACING_ENABLED", false)
+}
+
+// initTracer configures the global OpenTelemetry tracer provider, exporting spans via
+// OTLP/HTTP to OTEL_EXPORTER_OTLP_ENDPOINT, and returns a shutdown func to flush on exit.
+func initTracer() (func(context.Context) error, error) {
+	ctx := context.Background()
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create OTLP trace exporter: %v", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(tracerServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("unable to build OpenTelemetry resource: %v", err)
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tracerProvider)
+
+	return tracerProvider.Shutdown, nil
+}
+
+// tracingMiddleware wraps the gin handler chain with OpenTelemetry HTTP spans, whose
+// context propagates into downstream secrets-fetch calls.
+func tracingMiddleware() gin.HandlerFunc {
+	return otelgin.Middleware(tracerServiceName)
+}